@@ -1,25 +1,46 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"net"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"al.essio.dev/pkg/shellescape"
 	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/stitching/scripts/upload-runner/remotefs"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func main() {
 	includes := flag.String("i", "", "comma seperated list of globbed files to copy")
 	pkgName := flag.String("n", "stitch", "name to use within destination temp folder")
 	binName := flag.String("bin", "", "name of executable in destination")
-	runPerf := flag.Bool("perf", false, "whether to run the file or flamegraph")
+	profilerName := flag.String("profiler", "", "wrap the run with a remote profiler: flamegraph, perf-record, pprof-cpu, pprof-heap, strace, bpftrace")
+	flamegraphBin := flag.String("flamegraph-bin", os.Getenv("FLAMEGRAPH_BIN"), "path to the flamegraph binary on the remote host (defaults to 'flamegraph' on $PATH)")
+	pprofOpen := flag.Bool("pprof-open", false, "after a pprof-cpu/pprof-heap run, open the downloaded profile with 'go tool pprof'")
+	concurrency := flag.Int("j", 4, "number of included files to upload concurrently")
+	treeSpec := flag.String("tree", "", "local:remote directory to sync recursively with ClientW.SendTree, skipping files that already match on the remote (see -tree-hash)")
+	treeHash := flag.Bool("tree-hash", false, "for -tree, skip files by remote sha256sum instead of the cheaper size+mtime check")
+	var remoteForwards, localForwards addrSpecList
+	flag.Var(&remoteForwards, "R", "reverse port-forward, repeatable, parsed like OpenSSH: [remote_host:]remote_port:local_host:local_port")
+	flag.Var(&localForwards, "L", "local port-forward, repeatable, parsed like OpenSSH: [local_host:]local_port:remote_host:remote_port")
 	flag.Parse()
 
 	execPath := flag.Arg(0)
@@ -46,20 +67,62 @@ func main() {
 		log.Fatal("unable to transfer executable: ", err)
 	}
 
+	var includeMatches []string
 	for _, inc := range strings.Split(*includes, ",") {
 		matches, err := filepath.Glob(inc)
 		if err != nil {
 			log.Fatal("bad glob: ", err)
 		}
-		for _, p := range matches {
-			log.Printf("sending %q", p)
-			err = conn.SendFile(p, path.Join(dstFolder, filepath.ToSlash(p)), 0666)
-			if err != nil {
-				log.Fatalf("unable to transfer included file %q: %s", inc, err)
-			}
+		includeMatches = append(includeMatches, matches...)
+	}
+
+	if err := sendIncludedFiles(&conn, dstFolder, includeMatches, *concurrency); err != nil {
+		log.Fatal(err)
+	}
+
+	if *treeSpec != "" {
+		localRoot, remoteRoot, err := parseTreeSpec(*treeSpec)
+		if err != nil {
+			log.Fatalf("bad -tree %q: %s", *treeSpec, err)
+		}
+
+		opts := SyncOptions{Concurrency: *concurrency, VerifyHash: *treeHash, Progress: os.Stdout}
+		if err := conn.SendTree(localRoot, path.Join(dstFolder, remoteRoot), opts); err != nil {
+			log.Fatal("unable to sync tree: ", err)
 		}
 	}
 
+	var forwards []io.Closer
+	defer func() {
+		for _, f := range forwards {
+			f.Close()
+		}
+	}()
+
+	for _, spec := range remoteForwards {
+		remoteAddr, localAddr, err := parseForwardSpec(spec)
+		if err != nil {
+			log.Fatalf("bad -R %q: %s", spec, err)
+		}
+		closer, err := conn.ForwardRemote(remoteAddr, localAddr)
+		if err != nil {
+			log.Fatalf("unable to set up remote forward %q: %s", spec, err)
+		}
+		forwards = append(forwards, closer)
+	}
+
+	for _, spec := range localForwards {
+		localAddr, remoteAddr, err := parseForwardSpec(spec)
+		if err != nil {
+			log.Fatalf("bad -L %q: %s", spec, err)
+		}
+		closer, err := conn.ForwardLocal(localAddr, remoteAddr)
+		if err != nil {
+			log.Fatalf("unable to set up local forward %q: %s", spec, err)
+		}
+		forwards = append(forwards, closer)
+	}
+
 	session, err := conn.SpawnPty()
 	if err != nil {
 		log.Fatal("unable to create session: ", err)
@@ -70,33 +133,229 @@ func main() {
 	session.Stdout = os.Stdout
 	session.Stderr = os.Stderr
 
-	if *runPerf {
-		cmd := formatRunCmd(dstFolder, "/home/mc/.cargo/bin/flamegraph", append([]string{"-v", "--", dstFilename}, runArgs...))
+	profiler, err := resolveProfiler(*profilerName, *flamegraphBin)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		if err := session.Run(cmd); err != nil {
-			log.Fatal("failed to run: ", err)
-		}
+	runCmd, artifacts := profiler.WrapCommand(dstFilename, runArgs)
+	if err := session.Run(formatRunCmd(dstFolder, runCmd, nil)); err != nil {
+		log.Fatal("failed to run: ", err)
+	}
 
-		if err := conn.RecvFile(path.Join(dstFolder, "flamegraph.svg"), "flamegraph.svg"); err != nil {
-			log.Fatal("failed to receive flamegraph: ", err)
+	for _, artifact := range artifacts {
+		log.Printf("receiving %q", artifact)
+		if err := conn.RecvFile(path.Join(dstFolder, artifact), artifact); err != nil {
+			log.Fatalf("failed to receive %s: %s", artifact, err)
 		}
-	} else {
-		if err := session.Run(formatRunCmd(dstFolder, dstFilename, runArgs)); err != nil {
-			log.Fatal("failed to run: ", err)
+	}
+
+	if *pprofOpen {
+		if op, ok := profiler.(interface{ OpenLocally([]string) error }); ok {
+			if err := op.OpenLocally(artifacts); err != nil {
+				log.Println("failed to open profile: ", err)
+			}
 		}
 	}
 }
 
+// sendIncludedFiles uploads files to dstFolder, mirroring each local path
+// under it, using up to concurrency transfers at once.
+func sendIncludedFiles(conn *ClientW, dstFolder string, files []string, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for _, p := range files {
+		p := p
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			log.Printf("sending %q", p)
+			if err := conn.SendFile(p, path.Join(dstFolder, filepath.ToSlash(p)), 0666); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("unable to transfer included file %q: %w", p, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
 func formatRunCmd(dir string, prog string, args []string) string {
 	return strings.Join([]string{"cd", shellescape.Quote(dir), ";", prog, shellescape.QuoteCommand(args)}, " ")
 }
 
+// addrSpecList backs the repeatable -R/-L flags.
+type addrSpecList []string
+
+func (l *addrSpecList) String() string { return strings.Join(*l, ",") }
+
+func (l *addrSpecList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// parseTreeSpec splits a "local:remote" -tree argument into its local and
+// remote directory halves.
+func parseTreeSpec(spec string) (local, remote string, err error) {
+	local, remote, ok := strings.Cut(spec, ":")
+	if !ok || local == "" || remote == "" {
+		return "", "", fmt.Errorf("expected local:remote")
+	}
+	return local, remote, nil
+}
+
+// parseForwardSpec parses an OpenSSH-style forward spec into its two
+// host:port halves. Both the 4-field "bind_host:bind_port:host:port" form
+// and the 3-field "port:host:port" form (which binds to all interfaces,
+// same as OpenSSH) are accepted.
+func parseForwardSpec(spec string) (a, b string, err error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return ":" + parts[0], parts[1] + ":" + parts[2], nil
+	case 4:
+		return parts[0] + ":" + parts[1], parts[2] + ":" + parts[3], nil
+	default:
+		return "", "", fmt.Errorf("expected [bind_host:]port:host:port")
+	}
+}
+
+// Profiler describes how to wrap a remote command invocation so it runs
+// under a particular profiling tool.
+type Profiler interface {
+	// WrapCommand returns the remote shell command to run in place of
+	// bin/args, plus the paths (relative to the remote working directory)
+	// that should be pulled back with ClientW.RecvFile once it exits.
+	WrapCommand(bin string, args []string) (cmd string, artifacts []string)
+}
+
+// resolveProfiler looks up the Profiler named by -profiler. An empty name
+// runs the command unprofiled.
+func resolveProfiler(name, flamegraphBin string) (Profiler, error) {
+	switch name {
+	case "":
+		return noProfiler{}, nil
+	case "flamegraph":
+		return flamegraphProfiler{Bin: flamegraphBin}, nil
+	case "perf-record":
+		return perfRecordProfiler{}, nil
+	case "pprof-cpu":
+		return pprofProfiler{kind: "cpu"}, nil
+	case "pprof-heap":
+		return pprofProfiler{kind: "heap"}, nil
+	case "strace":
+		return straceProfiler{}, nil
+	case "bpftrace":
+		return bpftraceProfiler{}, nil
+	default:
+		return nil, fmt.Errorf("unknown -profiler %q", name)
+	}
+}
+
+type noProfiler struct{}
+
+func (noProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	return shellescape.QuoteCommand(append([]string{bin}, args...)), nil
+}
+
+// flamegraphProfiler runs the target under flamegraph(1), replacing the
+// previously hard-coded /home/mc/.cargo/bin/flamegraph path.
+type flamegraphProfiler struct {
+	Bin string
+}
+
+func (p flamegraphProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	fgBin := p.Bin
+	if fgBin == "" {
+		fgBin = "flamegraph"
+	}
+
+	cmd := fgBin + " " + shellescape.QuoteCommand(append([]string{"-v", "--", bin}, args...))
+	return cmd, []string{"flamegraph.svg"}
+}
+
+type perfRecordProfiler struct{}
+
+func (perfRecordProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	cmd := "perf record -F 99 -g -- " + shellescape.QuoteCommand(append([]string{bin}, args...))
+	return cmd, []string{"perf.data"}
+}
+
+// pprofProfiler injects CPUPROFILE or MEMPROFILE so a Go binary using
+// runtime/pprof's standard env-driven profiling writes its profile to a
+// known path, which OpenLocally can then hand to 'go tool pprof'.
+type pprofProfiler struct {
+	kind string // "cpu" or "heap"
+}
+
+func (p pprofProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	envVar, artifact := "CPUPROFILE", "cpu.pprof"
+	if p.kind == "heap" {
+		envVar, artifact = "MEMPROFILE", "heap.pprof"
+	}
+
+	cmd := envVar + "=" + shellescape.Quote(artifact) + " " + shellescape.QuoteCommand(append([]string{bin}, args...))
+	return cmd, []string{artifact}
+}
+
+func (p pprofProfiler) OpenLocally(artifacts []string) error {
+	if len(artifacts) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command("go", "tool", "pprof", artifacts[0])
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+type straceProfiler struct{}
+
+func (straceProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	cmd := "strace -f -o strace.log -- " + shellescape.QuoteCommand(append([]string{bin}, args...))
+	return cmd, []string{"strace.log"}
+}
+
+// bpftraceProfiler runs the target under `bpftrace -c`, counting syscalls by
+// default.
+type bpftraceProfiler struct {
+	Script string
+}
+
+func (p bpftraceProfiler) WrapCommand(bin string, args []string) (string, []string) {
+	script := p.Script
+	if script == "" {
+		script = "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
+	}
+
+	inner := shellescape.QuoteCommand(append([]string{bin}, args...))
+	cmd := "bpftrace -e " + shellescape.Quote(script) + " -o bpftrace.log -c " + shellescape.Quote(inner)
+	return cmd, []string{"bpftrace.log"}
+}
+
 type Config struct {
-	Username    string
-	PrivKeyPath string
-	Password    string
-	Host        string
-	Port        string
+	Username       string
+	PrivKeyPath    string
+	Password       string
+	Host           string
+	Port           string
+	KnownHostsPath string
 }
 
 var uploaderRe = regexp.MustCompile(`(.*?)(?:\[(.*)\])?(?::(.*))?\@([^\s:]*)(:\d+)?`)
@@ -136,11 +395,19 @@ func (inp Config) WithEnv() (out Config) {
 		out.Port = port
 	}
 
+	if knownHosts, ok := os.LookupEnv("UPLOAD_KNOWN_HOSTS"); ok {
+		out.KnownHostsPath = knownHosts
+	}
+
 	return
 }
 
 func (cfg Config) DialSSH() (ClientW, error) {
 	Auth := []ssh.AuthMethod{}
+	if am := agentAuthMethod(); am != nil {
+		Auth = append(Auth, am)
+	}
+
 	if cfg.PrivKeyPath != "" {
 		keyData, err := os.ReadFile(cfg.PrivKeyPath)
 		if err != nil {
@@ -162,11 +429,15 @@ func (cfg Config) DialSSH() (ClientW, error) {
 		Auth = append(Auth, ssh.Password(cfg.Password))
 	}
 
+	hostKeyCallback, err := cfg.hostKeyCallback()
+	if err != nil {
+		return ClientW{}, fmt.Errorf("unable to set up host key verification: %w", err)
+	}
+
 	config := &ssh.ClientConfig{
-		User: cfg.Username,
-		Auth: Auth,
-		// TODO: FIX THIS
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:            cfg.Username,
+		Auth:            Auth,
+		HostKeyCallback: hostKeyCallback,
 	}
 
 	if cfg.Host == "" {
@@ -177,54 +448,260 @@ func (cfg Config) DialSSH() (ClientW, error) {
 	}
 
 	conn, err := ssh.Dial("tcp", cfg.Host+cfg.Port, config)
-	return ClientW{conn}, err
+	return ClientW{Client: conn}, err
+}
+
+// agentAuthMethod returns an ssh.AuthMethod backed by a running ssh-agent
+// reachable via SSH_AUTH_SOCK, or nil if no agent is available.
+func agentAuthMethod() ssh.AuthMethod {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers)
+}
+
+// hostKeyCallback builds an ssh.HostKeyCallback backed by cfg.KnownHostsPath
+// (or ~/.ssh/known_hosts if unset). Keys that don't match a known entry are
+// rejected outright, while hosts missing from the file entirely are verified
+// via trust-on-first-use: the fingerprint is printed to stdout, the answer is
+// read from stdin and, if accepted, the key is appended to the known_hosts
+// file.
+func (cfg Config) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	khPath := cfg.KnownHostsPath
+	if khPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		khPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	if _, err := os.Stat(khPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(khPath), 0700); err != nil {
+			return nil, fmt.Errorf("unable to create %q: %w", filepath.Dir(khPath), err)
+		}
+		f, err := os.OpenFile(khPath, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create known_hosts %q: %w", khPath, err)
+		}
+		f.Close()
+	}
+
+	verify, err := knownhosts.New(khPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load known_hosts %q: %w", khPath, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verify(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) != 0 {
+			// Either a non-knownhosts error, or the host is known but
+			// presented a different key: treat both as a hard failure.
+			return err
+		}
+
+		fmt.Printf("The authenticity of host %q can't be established.\n%s key fingerprint is %s.\nAre you sure you want to continue connecting (yes/no)? ", hostname, key.Type(), ssh.FingerprintSHA256(key))
+
+		resp, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(resp)) != "yes" {
+			return fmt.Errorf("host key verification refused for %q", hostname)
+		}
+
+		f, err := os.OpenFile(khPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to update known_hosts: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+			return fmt.Errorf("unable to update known_hosts: %w", err)
+		}
+
+		return nil
+	}, nil
 }
 
 type ClientW struct {
 	*ssh.Client
+
+	mu  sync.Mutex
+	ftp *sftp.Client
+}
+
+// sftpClient lazily dials the single *sftp.Client shared by every remotefs
+// operation on c, instead of opening a new SFTP session per call.
+func (c *ClientW) sftpClient() (*sftp.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ftp != nil {
+		return c.ftp, nil
+	}
+
+	ftp, err := sftp.NewClient(c.Client, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		return nil, err
+	}
+
+	c.ftp = ftp
+	return ftp, nil
 }
 
-func (c ClientW) SendFile(src string, dst string, mode os.FileMode) error {
-	ftp, err := sftp.NewClient(c.Client, sftp.UseConcurrentWrites(false))
+// FS returns an afero.Fs view of the remote host, backed by c's shared SFTP
+// session.
+func (c *ClientW) FS() (afero.Fs, error) {
+	ftp, err := c.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return remotefs.New(ftp), nil
+}
+
+func (c *ClientW) Close() error {
+	if c.ftp != nil {
+		c.ftp.Close()
+	}
+	return c.Client.Close()
+}
+
+// SendFile uploads src to dst atomically: it writes to a "<dst>.partial"
+// path, fsyncs it, verifies it against a remote sha256sum of the .partial
+// itself, and only then renames it into place, so a connection dropped or a
+// corrupt transfer never leaves a half-written or bad dst that might get
+// executed. If a .partial from a previous attempt is already present and no
+// bigger than src, the transfer resumes from that offset instead of
+// restarting; otherwise the .partial is truncated before writing.
+func (c *ClientW) SendFile(src string, dst string, mode os.FileMode) error {
+	rfs, err := c.FS()
 	if err != nil {
 		return err
 	}
-	defer ftp.Close()
 
-	src_file, err := os.Open(src)
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	srcInfo, err := srcFile.Stat()
 	if err != nil {
 		return err
 	}
-	defer src_file.Close()
 
 	dstDir, _ := path.Split(dst)
-	if err = ftp.MkdirAll(dstDir); err != nil {
+	if err := rfs.MkdirAll(dstDir, 0755); err != nil {
 		log.Println("dir failed", dstDir)
 		return err
 	}
 
-	dst_file, err := ftp.Create(dst)
+	partial := dst + ".partial"
+
+	var offset int64
+	if partialInfo, statErr := rfs.Stat(partial); statErr == nil {
+		if partialInfo.Size() <= srcInfo.Size() {
+			offset = partialInfo.Size()
+		}
+	} else if !os.IsNotExist(statErr) {
+		return statErr
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		// No usable resume point: truncate rather than overwrite a prefix
+		// of a larger stale .partial and leave its tail behind.
+		flags |= os.O_TRUNC
+	}
+
+	partialFile, err := rfs.OpenFile(partial, flags, mode)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		log.Printf("resuming %q at offset %d", dst, offset)
+
+		if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+			partialFile.Close()
+			return err
+		}
+		if _, err := partialFile.Seek(offset, io.SeekStart); err != nil {
+			partialFile.Close()
+			return err
+		}
+	}
+
+	if _, err := io.Copy(partialFile, srcFile); err != nil {
+		partialFile.Close()
+		return err
+	}
+
+	if syncer, ok := partialFile.(interface{ Fsync() error }); ok {
+		if err := syncer.Fsync(); err != nil {
+			log.Printf("fsync %q: %s (continuing)", partial, err)
+		}
+	}
+
+	if err := partialFile.Close(); err != nil {
+		return err
+	}
+
+	if err := rfs.Chmod(partial, mode); err != nil {
+		return err
+	}
+
+	localSum, err := sha256File(src)
 	if err != nil {
 		return err
 	}
-	defer dst_file.Close()
 
-	_, err = dst_file.ReadFrom(src_file)
+	remoteSum, err := c.remoteSHA256(partial)
+	if err != nil {
+		return fmt.Errorf("unable to verify %q remotely: %w", partial, err)
+	}
+
+	if localSum != remoteSum {
+		return fmt.Errorf("checksum mismatch for %q: local %s, remote %s", partial, localSum, remoteSum)
+	}
+
+	return c.renameIntoPlace(partial, dst)
+}
+
+// renameIntoPlace moves partial to dst, preferring the POSIX rename
+// extension (which overwrites an existing dst) and falling back to the
+// plain SFTP rename when the server doesn't support it.
+func (c *ClientW) renameIntoPlace(partial, dst string) error {
+	ftp, err := c.sftpClient()
 	if err != nil {
 		return err
 	}
 
-	return dst_file.Chmod(mode)
+	if err := ftp.PosixRename(partial, dst); err != nil {
+		return ftp.Rename(partial, dst)
+	}
+
+	return nil
 }
 
-func (c ClientW) RecvFile(src string, dst string) error {
-	ftp, err := sftp.NewClient(c.Client, sftp.UseConcurrentWrites(false))
+func (c *ClientW) RecvFile(src string, dst string) error {
+	rfs, err := c.FS()
 	if err != nil {
 		return err
 	}
-	defer ftp.Close()
 
-	srcFile, err := ftp.Open(src)
+	srcFile, err := rfs.Open(src)
 	if err != nil {
 		return err
 	}
@@ -236,15 +713,311 @@ func (c ClientW) RecvFile(src string, dst string) error {
 	}
 	defer dstFile.Close()
 
-	_, err = dstFile.ReadFrom(srcFile)
+	_, err = io.Copy(dstFile, srcFile)
+	return err
+}
+
+// SyncOptions configures ClientW.SendTree.
+type SyncOptions struct {
+	// Concurrency is the number of files uploaded at once. Defaults to 4.
+	Concurrency int
+	// VerifyHash, when set, skips files whose remote sha256sum (computed
+	// via a remote exec session) matches the local digest, instead of the
+	// cheaper size/mtime heuristic used by default.
+	VerifyHash bool
+	// Progress, if non-nil, receives one line per completed file plus a
+	// final aggregate summary.
+	Progress io.Writer
+}
+
+// SendTree walks localRoot and uploads every file to the matching path
+// under remoteRoot, using up to opts.Concurrency concurrent transfers over
+// the shared SFTP session. Files whose remote copy has the same size and an
+// mtime no older than the local one (or, with opts.VerifyHash, the same size
+// and sha256) are skipped.
+func (c *ClientW) SendTree(localRoot, remoteRoot string, opts SyncOptions) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	rfs, err := c.FS()
 	if err != nil {
 		return err
 	}
 
+	var rels []string
+	err = filepath.WalkDir(localRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(localRoot, p)
+		if err != nil {
+			return err
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var totalBytes int64
+
+	for _, rel := range rels {
+		rel := rel
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			local := filepath.Join(localRoot, filepath.FromSlash(rel))
+			dst := path.Join(remoteRoot, rel)
+
+			n, skipped, err := c.sendTreeFile(rfs, local, dst, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", rel, err)
+				}
+				return
+			}
+
+			totalBytes += n
+			if opts.Progress != nil {
+				status := "sent"
+				if skipped {
+					status = "skip"
+				}
+				fmt.Fprintf(opts.Progress, "%s %s (%d bytes)\n", status, rel, n)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if opts.Progress != nil {
+		fmt.Fprintf(opts.Progress, "done: %d files, %d bytes\n", len(rels), totalBytes)
+	}
+
 	return nil
 }
 
-func (c ClientW) SpawnPty() (sw SessionW, err error) {
+func (c *ClientW) sendTreeFile(rfs afero.Fs, local, dst string, opts SyncOptions) (n int64, skipped bool, err error) {
+	srcInfo, err := os.Stat(local)
+	if err != nil {
+		return 0, false, err
+	}
+
+	skip, err := c.shouldSkip(rfs, local, dst, srcInfo, opts)
+	if err != nil {
+		return 0, false, err
+	}
+	if skip {
+		return srcInfo.Size(), true, nil
+	}
+
+	srcFile, err := os.Open(local)
+	if err != nil {
+		return 0, false, err
+	}
+	defer srcFile.Close()
+
+	dstDir, _ := path.Split(dst)
+	if err := rfs.MkdirAll(dstDir, 0755); err != nil {
+		return 0, false, err
+	}
+
+	dstFile, err := rfs.Create(dst)
+	if err != nil {
+		return 0, false, err
+	}
+	defer dstFile.Close()
+
+	if crf, ok := dstFile.(interface {
+		ReadFromWithConcurrency(io.Reader, int) (int64, error)
+	}); ok {
+		n, err = crf.ReadFromWithConcurrency(srcFile, opts.Concurrency)
+	} else {
+		n, err = io.Copy(dstFile, srcFile)
+	}
+	if err != nil {
+		return n, false, err
+	}
+
+	return n, false, rfs.Chmod(dst, srcInfo.Mode())
+}
+
+// shouldSkip reports whether dst already holds the contents of local.
+func (c *ClientW) shouldSkip(rfs afero.Fs, local, dst string, srcInfo os.FileInfo, opts SyncOptions) (bool, error) {
+	dstInfo, err := rfs.Stat(dst)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if dstInfo.Size() != srcInfo.Size() {
+		return false, nil
+	}
+
+	if !opts.VerifyHash {
+		return !dstInfo.ModTime().Before(srcInfo.ModTime()), nil
+	}
+
+	localSum, err := sha256File(local)
+	if err != nil {
+		return false, err
+	}
+
+	remoteSum, err := c.remoteSHA256(dst)
+	if err != nil {
+		return false, err
+	}
+
+	return localSum == remoteSum, nil
+}
+
+func sha256File(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteSHA256 runs sha256sum over remotePath via a short-lived exec
+// session and returns the resulting hex digest.
+func (c *ClientW) remoteSHA256(remotePath string) (string, error) {
+	session, err := c.Client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.Output("sha256sum " + shellescape.Quote(remotePath))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected sha256sum output for %q: %q", remotePath, out)
+	}
+
+	return fields[0], nil
+}
+
+// ForwardRemote listens on remoteAddr on the SSH server and, for every
+// connection it accepts, dials localAddr on this machine and pipes the two
+// together. It implements the -R side of port forwarding: a remote binary
+// can reach a local dev service without the firewall needing to open
+// anything.
+func (c *ClientW) ForwardRemote(remoteAddr, localAddr string) (io.Closer, error) {
+	listener, err := c.Client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			remoteConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer remoteConn.Close()
+
+				localConn, err := net.Dial("tcp", localAddr)
+				if err != nil {
+					log.Printf("forward %s -> %s: %s", remoteAddr, localAddr, err)
+					return
+				}
+				defer localConn.Close()
+
+				pipeConns(remoteConn, localConn)
+			}()
+		}
+	}()
+
+	return listener, nil
+}
+
+// ForwardLocal listens on localAddr on this machine and, for every
+// connection it accepts, dials remoteAddr through the SSH connection and
+// pipes the two together. It implements the -L side of port forwarding.
+func (c *ClientW) ForwardLocal(localAddr, remoteAddr string) (io.Closer, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			localConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer localConn.Close()
+
+				remoteConn, err := c.Client.Dial("tcp", remoteAddr)
+				if err != nil {
+					log.Printf("forward %s -> %s: %s", localAddr, remoteAddr, err)
+					return
+				}
+				defer remoteConn.Close()
+
+				pipeConns(localConn, remoteConn)
+			}()
+		}
+	}()
+
+	return listener, nil
+}
+
+// pipeConns copies in both directions between a and b until either side
+// closes.
+func pipeConns(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+func (c *ClientW) SpawnPty() (sw SessionW, err error) {
 	session, err := c.Client.NewSession()
 	if err != nil {
 		return
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	cases := []struct {
+		spec    string
+		a, b    string
+		wantErr bool
+	}{
+		{spec: "9000:localhost:5432", a: ":9000", b: "localhost:5432"},
+		{spec: "0.0.0.0:9000:localhost:5432", a: "0.0.0.0:9000", b: "localhost:5432"},
+		{spec: "bad", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+	}
+
+	for _, c := range cases {
+		a, b, err := parseForwardSpec(c.spec)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseForwardSpec(%q): expected error, got none", c.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseForwardSpec(%q): unexpected error: %s", c.spec, err)
+			continue
+		}
+		if a != c.a || b != c.b {
+			t.Errorf("parseForwardSpec(%q) = %q, %q; want %q, %q", c.spec, a, b, c.a, c.b)
+		}
+	}
+}
+
+func TestParseTreeSpec(t *testing.T) {
+	local, remote, err := parseTreeSpec("./dist:/srv/app")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if local != "./dist" || remote != "/srv/app" {
+		t.Fatalf("got %q, %q", local, remote)
+	}
+
+	if _, _, err := parseTreeSpec("no-colon"); err == nil {
+		t.Fatal("expected error for missing colon")
+	}
+}
+
+func TestShouldSkip(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(local, []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	srcInfo, err := os.Stat(local)
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+
+	rfs := afero.NewMemMapFs()
+	var c ClientW
+
+	skip, err := c.shouldSkip(rfs, local, "/dst/file.txt", srcInfo, SyncOptions{})
+	if err != nil {
+		t.Fatalf("shouldSkip (missing dst): %s", err)
+	}
+	if skip {
+		t.Fatal("expected no skip when remote file doesn't exist yet")
+	}
+
+	if err := afero.WriteFile(rfs, "/dst/file.txt", []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile (mem): %s", err)
+	}
+	if err := rfs.Chtimes("/dst/file.txt", time.Now(), srcInfo.ModTime().Add(time.Hour)); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+
+	skip, err = c.shouldSkip(rfs, local, "/dst/file.txt", srcInfo, SyncOptions{})
+	if err != nil {
+		t.Fatalf("shouldSkip (matching size+mtime): %s", err)
+	}
+	if !skip {
+		t.Fatal("expected skip when remote is same size and at least as new")
+	}
+
+	if err := afero.WriteFile(rfs, "/dst/file.txt", []byte("helloo"), 0644); err != nil {
+		t.Fatalf("WriteFile (mem, mismatched size): %s", err)
+	}
+
+	skip, err = c.shouldSkip(rfs, local, "/dst/file.txt", srcInfo, SyncOptions{})
+	if err != nil {
+		t.Fatalf("shouldSkip (mismatched size): %s", err)
+	}
+	if skip {
+		t.Fatal("expected no skip when sizes differ")
+	}
+}
+
+// TestOpenFileTruncatesStalePartial checks the behavior SendFile relies on
+// when it has no usable resume offset, using the same flags it opens the
+// .partial with (os.O_WRONLY|os.O_CREATE|os.O_TRUNC); SendFile itself is not
+// called. Writing a shorter file over a longer stale .partial must not leave
+// the old tail behind. remotefs.Fs.OpenFile
+// forwards flags to sftp.Client.OpenFile exactly like afero.MemMapFs does
+// here, so this is representative of the real remote behavior.
+func TestOpenFileTruncatesStalePartial(t *testing.T) {
+	rfs := afero.NewMemMapFs()
+	if err := afero.WriteFile(rfs, "/dst.partial", []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	f, err := rfs.OpenFile("/dst.partial", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	if _, err := f.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	f.Close()
+
+	got, err := afero.ReadFile(rfs, "/dst.partial")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if string(got) != "abc" {
+		t.Fatalf("got %q, want %q", got, "abc")
+	}
+}
+
+func TestSha256File(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(p, []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	got, err := sha256File(p)
+	if err != nil {
+		t.Fatalf("sha256File: %s", err)
+	}
+
+	const want = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
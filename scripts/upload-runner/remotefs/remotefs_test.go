@@ -0,0 +1,121 @@
+package remotefs
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestClient wires an *sftp.Client straight to an in-memory SFTP handler
+// over a net.Pipe, so Fs can be exercised without a real SSH connection.
+func newTestClient(t *testing.T) *sftp.Client {
+	t.Helper()
+
+	serverConn, clientConn := net.Pipe()
+
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("NewClientPipe: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestFsCreateWriteOpen(t *testing.T) {
+	fs := New(newTestClient(t))
+
+	f, err := fs.Create("/greeting.txt")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	if _, err := f.WriteString("hello"); err != nil {
+		t.Fatalf("WriteString: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	r, err := fs.Open("/greeting.txt")
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestFsMkdirAllAndRemoveAll(t *testing.T) {
+	fs := New(newTestClient(t))
+
+	if err := fs.MkdirAll("/a/b/c", 0755); err != nil {
+		t.Fatalf("MkdirAll: %s", err)
+	}
+
+	f, err := fs.Create("/a/b/c/file.txt")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	f.Close()
+
+	if err := fs.RemoveAll("/a"); err != nil {
+		t.Fatalf("RemoveAll: %s", err)
+	}
+
+	if _, err := fs.Stat("/a"); !os.IsNotExist(err) {
+		t.Fatalf("expected /a to be gone, got err=%v", err)
+	}
+}
+
+// TestFileFsync confirms File exposes an Fsync() error method (the shape
+// ClientW.SendFile type-asserts for) that actually reaches the wrapped
+// *sftp.File, rather than the no-op Sync required by afero.File. The
+// in-memory test server doesn't implement the fsync@openssh.com extension,
+// so the call is expected to error, not to succeed silently.
+func TestFileFsync(t *testing.T) {
+	fs := New(newTestClient(t))
+
+	f, err := fs.Create("/fsync.txt")
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	defer f.Close()
+
+	syncer, ok := f.(interface{ Fsync() error })
+	if !ok {
+		t.Fatal("File does not implement Fsync() error")
+	}
+	if err := syncer.Fsync(); err == nil {
+		t.Fatal("expected an error from Fsync against a server without the fsync extension")
+	}
+}
+
+// TestFsChmod only checks that Chmod round-trips through the SFTP protocol
+// without error; sftp.InMemHandler doesn't track permissions, so the
+// resulting mode can't be asserted here.
+func TestFsChmod(t *testing.T) {
+	fs := New(newTestClient(t))
+
+	f, err := fs.OpenFile("/mode.txt", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+	f.Close()
+
+	if err := fs.Chmod("/mode.txt", 0600); err != nil {
+		t.Fatalf("Chmod: %s", err)
+	}
+}